@@ -0,0 +1,189 @@
+package openstack
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/container/v1/capsules"
+	"github.com/gophercloud/gophercloud/pagination"
+	"k8s.io/api/core/v1"
+)
+
+// defaultPodCacheResyncInterval is how often podCache re-lists capsules
+// from Zun when no other interval is configured.
+const defaultPodCacheResyncInterval = 10 * time.Second
+
+// podCache keeps an indexed, periodically-refreshed view of the capsules
+// belonging to this node so that GetPod/GetPods/GetPodStatus don't have to
+// hit Zun on every call. It mirrors the podFullName/StartTime preservation
+// behavior of kubelet's statusManager: a resync that finds a pod already in
+// the cache carries forward its StartTime and only pushes a change when the
+// converted Pod actually differs from what's cached.
+type podCache struct {
+	client   *gophercloud.ServiceClient
+	nodeName string
+	interval time.Duration
+
+	mu     sync.RWMutex
+	pods   map[string]*v1.Pod
+	synced bool
+
+	changes chan *v1.Pod
+	stopCh  chan struct{}
+}
+
+// newPodCache creates a podCache for the given Zun client/node. Call run
+// to start its resync loop.
+func newPodCache(client *gophercloud.ServiceClient, nodeName string, interval time.Duration) *podCache {
+	if interval <= 0 {
+		interval = defaultPodCacheResyncInterval
+	}
+
+	return &podCache{
+		client:   client,
+		nodeName: nodeName,
+		interval: interval,
+		pods:     make(map[string]*v1.Pod),
+		changes:  make(chan *v1.Pod, 32),
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// run starts the resync loop in a goroutine; call stop to shut it down.
+func (c *podCache) run() {
+	go func() {
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+
+		c.resync()
+		for {
+			select {
+			case <-ticker.C:
+				c.resync()
+			case <-c.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// stop terminates the resync loop. It is safe to call at most once.
+func (c *podCache) stop() {
+	close(c.stopCh)
+}
+
+// changesChan exposes the channel of pods whose status changed on the most
+// recent resync, so the virtual-kubelet manager can subscribe to pushed
+// updates instead of polling.
+func (c *podCache) changesChan() <-chan *v1.Pod {
+	return c.changes
+}
+
+// get returns the cached pod for namespace/name, or nil if it is not
+// present (a cache miss, not a guarantee the pod doesn't exist in Zun).
+func (c *podCache) get(namespace, name string) *v1.Pod {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.pods[podCacheKey(namespace, name)]
+}
+
+// list returns every pod currently in the cache.
+func (c *podCache) list() []*v1.Pod {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	pods := make([]*v1.Pod, 0, len(c.pods))
+	for _, pod := range c.pods {
+		pods = append(pods, pod)
+	}
+	return pods
+}
+
+// hasSynced reports whether resync has completed at least once, so callers
+// can trust an empty list() result to mean "no pods" rather than "cache not
+// populated yet" - len(list()) == 0 is ambiguous between those two cases.
+func (c *podCache) hasSynced() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.synced
+}
+
+func podCacheKey(namespace, name string) string {
+	return fmt.Sprintf("%s/%s", namespace, name)
+}
+
+// resync pulls the capsules owned by this node, converts them, and merges
+// the result into the cache a key at a time so that a pod we fail to
+// convert doesn't blow away the rest of the cache.
+func (c *podCache) resync() {
+	seen := make(map[string]bool)
+
+	pager := capsules.List(c.client, nil)
+	err := pager.EachPage(func(page pagination.Page) (bool, error) {
+		capsuleList, err := capsules.ExtractCapsules(page)
+		if err != nil {
+			return false, err
+		}
+
+		for _, m := range capsuleList {
+			capsule := m
+			if capsule.MetaLabels["NodeName"] != c.nodeName {
+				continue
+			}
+
+			pod, err := capsuleToPod(&capsule)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+
+			key := podCacheKey(pod.Namespace, pod.Name)
+			seen[key] = true
+			c.update(key, pod)
+		}
+		return true, nil
+	})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	c.mu.Lock()
+	for key := range c.pods {
+		if !seen[key] {
+			delete(c.pods, key)
+		}
+	}
+	c.synced = true
+	c.mu.Unlock()
+}
+
+// update merges a freshly-converted pod into the cache, preserving
+// StartTime across resyncs and only publishing a change when something
+// actually differs from what was cached before.
+func (c *podCache) update(key string, pod *v1.Pod) {
+	c.mu.Lock()
+	old, existed := c.pods[key]
+	if existed && old.Status.StartTime != nil {
+		pod.Status.StartTime = old.Status.StartTime
+	}
+	c.pods[key] = pod
+	c.mu.Unlock()
+
+	if existed && reflect.DeepEqual(old, pod) {
+		return
+	}
+
+	select {
+	case c.changes <- pod:
+	default:
+		// The subscriber isn't keeping up; drop the update rather than
+		// block the resync loop. The next resync will carry the latest
+		// state regardless.
+		log.Println("podCache: changes channel full, dropping update for", key)
+	}
+}
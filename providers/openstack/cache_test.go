@@ -0,0 +1,103 @@
+package openstack
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestPodCache() *podCache {
+	return newPodCache(nil, "test-node", time.Minute)
+}
+
+func TestPodCacheUpdateCarriesForwardStartTime(t *testing.T) {
+	c := newTestPodCache()
+	key := podCacheKey("default", "my-pod")
+
+	firstStart := metav1.NewTime(time.Unix(1000, 0))
+	first := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-pod", Namespace: "default"},
+		Status:     v1.PodStatus{Phase: v1.PodRunning, StartTime: &firstStart},
+	}
+	c.update(key, first)
+
+	laterStart := metav1.NewTime(time.Unix(2000, 0))
+	second := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-pod", Namespace: "default"},
+		Status:     v1.PodStatus{Phase: v1.PodRunning, Message: "updated", StartTime: &laterStart},
+	}
+	c.update(key, second)
+
+	got := c.get("default", "my-pod")
+	if got == nil {
+		t.Fatal("expected cached pod, got nil")
+	}
+	if !got.Status.StartTime.Equal(&firstStart) {
+		t.Errorf("StartTime = %v, want the original %v to be carried forward", got.Status.StartTime, firstStart)
+	}
+}
+
+func TestPodCacheUpdateSkipsPublishingUnchangedStatus(t *testing.T) {
+	c := newTestPodCache()
+	key := podCacheKey("default", "my-pod")
+
+	start := metav1.NewTime(time.Unix(1000, 0))
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-pod", Namespace: "default"},
+		Status:     v1.PodStatus{Phase: v1.PodRunning, StartTime: &start},
+	}
+
+	c.update(key, pod)
+	drain(t, c, "expected a change to be published for a new pod")
+
+	// Re-apply a deep-equal pod; nothing changed, so nothing should be
+	// published a second time.
+	unchanged := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-pod", Namespace: "default"},
+		Status:     v1.PodStatus{Phase: v1.PodRunning, StartTime: &start},
+	}
+	c.update(key, unchanged)
+
+	select {
+	case p := <-c.changesChan():
+		t.Errorf("expected no change to be published for an unchanged pod, got %+v", p)
+	default:
+	}
+}
+
+func TestPodCacheHasSyncedDistinguishesEmptyFromUnsynced(t *testing.T) {
+	c := newTestPodCache()
+
+	if c.hasSynced() {
+		t.Fatal("hasSynced() = true before any resync has run")
+	}
+	if got := c.list(); len(got) != 0 {
+		t.Fatalf("list() = %+v, want empty before any resync has run", got)
+	}
+
+	// A resync that finds nothing (e.g. an idle node with zero pods) must
+	// still flip hasSynced, so callers can tell "no pods" apart from
+	// "cache not populated yet" instead of using len(list())==0 as a
+	// cache-miss proxy.
+	c.mu.Lock()
+	c.synced = true
+	c.mu.Unlock()
+
+	if !c.hasSynced() {
+		t.Error("hasSynced() = false after a resync completed")
+	}
+	if got := c.list(); len(got) != 0 {
+		t.Errorf("list() = %+v, want empty for a node with no pods", got)
+	}
+}
+
+func drain(t *testing.T, c *podCache, failMsg string) {
+	t.Helper()
+	select {
+	case <-c.changesChan():
+	default:
+		t.Fatal(failMsg)
+	}
+}
@@ -0,0 +1,245 @@
+package openstack
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/hypervisors"
+	"github.com/gophercloud/gophercloud/pagination"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// defaultPressureThreshold is the fraction of hypervisor memory/disk usage
+// above which nodeInfo reports MemoryPressure/DiskPressure, unless
+// overridden by OS_MEMORY_PRESSURE_THRESHOLD/OS_DISK_PRESSURE_THRESHOLD.
+const defaultPressureThreshold = 0.8
+
+// nodeInfo collects Capacity/NodeConditions/NodeAddresses from Nova's
+// os-hypervisors/detail endpoint on its own ticker, at the same interval
+// podCache uses to resync pod status (NewZunProvider passes
+// defaultPodCacheResyncInterval to both), so a stale node report doesn't
+// lag pod status by much. The two tickers are not synchronised. Its zero value reports nothing usable; use newNodeInfo.
+type nodeInfo struct {
+	computeClient *gophercloud.ServiceClient
+	computeHost   string
+	interval      time.Duration
+
+	memoryPressureThreshold float64
+	diskPressureThreshold   float64
+
+	mu         sync.RWMutex
+	capacity   v1.ResourceList
+	conditions []v1.NodeCondition
+	addresses  []v1.NodeAddress
+
+	stopCh chan struct{}
+}
+
+func newNodeInfo(computeClient *gophercloud.ServiceClient, interval time.Duration) *nodeInfo {
+	if interval <= 0 {
+		interval = defaultPodCacheResyncInterval
+	}
+
+	return &nodeInfo{
+		computeClient:           computeClient,
+		computeHost:             os.Getenv("OS_COMPUTE_HOST"),
+		interval:                interval,
+		memoryPressureThreshold: floatEnv("OS_MEMORY_PRESSURE_THRESHOLD", defaultPressureThreshold),
+		diskPressureThreshold:   floatEnv("OS_DISK_PRESSURE_THRESHOLD", defaultPressureThreshold),
+		stopCh:                  make(chan struct{}),
+	}
+}
+
+func floatEnv(name string, def float64) float64 {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return def
+	}
+	return f
+}
+
+// run starts the resync loop in a goroutine; call stop to shut it down.
+func (n *nodeInfo) run() {
+	go func() {
+		ticker := time.NewTicker(n.interval)
+		defer ticker.Stop()
+
+		n.resync()
+		for {
+			select {
+			case <-ticker.C:
+				n.resync()
+			case <-n.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+func (n *nodeInfo) stop() {
+	close(n.stopCh)
+}
+
+// resync pulls os-hypervisors/detail and aggregates capacity/pressure.
+// When OS_COMPUTE_HOST names a specific hypervisor, only that host's
+// totals are used; otherwise every hypervisor Nova reports is summed.
+func (n *nodeInfo) resync() {
+	var (
+		vcpus, vcpusUsed     int
+		memoryMB, memUsedMB  int
+		localGB, localGBUsed int
+		hostIP               string
+	)
+
+	pager := hypervisors.List(n.computeClient)
+	err := pager.EachPage(func(page pagination.Page) (bool, error) {
+		hvs, err := hypervisors.ExtractHypervisors(page)
+		if err != nil {
+			return false, err
+		}
+
+		for _, hv := range hvs {
+			if n.computeHost != "" && hv.HypervisorHostname != n.computeHost {
+				continue
+			}
+
+			vcpus += hv.VCPUs
+			vcpusUsed += hv.VCPUsUsed
+			memoryMB += hv.MemoryMB
+			memUsedMB += hv.MemoryMBUsed
+			localGB += hv.LocalGB
+			localGBUsed += hv.LocalGBUsed
+			if hostIP == "" {
+				hostIP = hv.HostIP
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		log.Println("nodeInfo: unable to list hypervisors, keeping previous/default node info:", err)
+		return
+	}
+	if vcpus == 0 && memoryMB == 0 {
+		log.Println("nodeInfo: no matching hypervisor found, keeping previous/default node info")
+		return
+	}
+
+	// Nova doesn't report a "max instances" figure directly, so approximate
+	// pod capacity at one capsule per vCPU across the matching
+	// hypervisor(s) - the same bin-packing assumption the cpu capacity
+	// above already makes.
+	capacity := v1.ResourceList{
+		"cpu":    resource.MustParse(strconv.Itoa(vcpus)),
+		"memory": resource.MustParse(strconv.Itoa(memoryMB) + "Mi"),
+		"pods":   resource.MustParse(strconv.Itoa(vcpus)),
+	}
+
+	conditions := []v1.NodeCondition{
+		{
+			Type:               "Ready",
+			Status:             v1.ConditionTrue,
+			LastHeartbeatTime:  metav1.Now(),
+			LastTransitionTime: metav1.Now(),
+			Reason:             "KubeletReady",
+			Message:            "kubelet is ready.",
+		},
+		{
+			Type:               "OutOfDisk",
+			Status:             v1.ConditionFalse,
+			LastHeartbeatTime:  metav1.Now(),
+			LastTransitionTime: metav1.Now(),
+			Reason:             "KubeletHasSufficientDisk",
+			Message:            "kubelet has sufficient disk space available",
+		},
+		pressureCondition("MemoryPressure", memUsedMB, memoryMB, n.memoryPressureThreshold,
+			"KubeletHasSufficientMemory", "kubelet has sufficient memory available",
+			"KubeletHasInsufficientMemory", "kubelet has insufficient memory available"),
+		pressureCondition("DiskPressure", localGBUsed, localGB, n.diskPressureThreshold,
+			"KubeletHasNoDiskPressure", "kubelet has no disk pressure",
+			"KubeletHasDiskPressure", "kubelet has disk pressure"),
+		{
+			Type:               "NetworkUnavailable",
+			Status:             v1.ConditionFalse,
+			LastHeartbeatTime:  metav1.Now(),
+			LastTransitionTime: metav1.Now(),
+			Reason:             "RouteCreated",
+			Message:            "RouteController created a route",
+		},
+	}
+
+	// hostIP is the hypervisor's internal management address, not a
+	// publicly-routable one, so it's only ever reported as NodeInternalIP.
+	// Nova's hypervisor API doesn't expose a per-node floating IP for us
+	// to report as NodeExternalIP instead.
+	var addresses []v1.NodeAddress
+	if hostIP != "" {
+		addresses = append(addresses, v1.NodeAddress{Type: v1.NodeInternalIP, Address: hostIP})
+	}
+
+	n.mu.Lock()
+	n.capacity = capacity
+	n.conditions = conditions
+	n.addresses = addresses
+	n.mu.Unlock()
+}
+
+// pressureCondition reports Status True once used/total crosses threshold.
+func pressureCondition(condType v1.NodeConditionType, used, total int, threshold float64, okReason, okMessage, pressureReason, pressureMessage string) v1.NodeCondition {
+	status := v1.ConditionFalse
+	reason := okReason
+	message := okMessage
+
+	if total > 0 && float64(used)/float64(total) >= threshold {
+		status = v1.ConditionTrue
+		reason = pressureReason
+		message = pressureMessage
+	}
+
+	return v1.NodeCondition{
+		Type:               condType,
+		Status:             status,
+		LastHeartbeatTime:  metav1.Now(),
+		LastTransitionTime: metav1.Now(),
+		Reason:             reason,
+		Message:            message,
+	}
+}
+
+// getCapacity returns the last-resynced Capacity, or ok=false if nodeInfo
+// has never successfully resynced.
+func (n *nodeInfo) getCapacity() (v1.ResourceList, bool) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.capacity == nil {
+		return nil, false
+	}
+	return n.capacity, true
+}
+
+// getConditions returns the last-resynced NodeConditions, or ok=false if
+// nodeInfo has never successfully resynced.
+func (n *nodeInfo) getConditions() ([]v1.NodeCondition, bool) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.conditions == nil {
+		return nil, false
+	}
+	return n.conditions, true
+}
+
+// getAddresses returns the last-resynced NodeAddresses.
+func (n *nodeInfo) getAddresses() []v1.NodeAddress {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.addresses
+}
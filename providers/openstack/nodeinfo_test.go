@@ -0,0 +1,41 @@
+package openstack
+
+import (
+	"testing"
+
+	"k8s.io/api/core/v1"
+)
+
+func TestPressureCondition(t *testing.T) {
+	cases := []struct {
+		name      string
+		used      int
+		total     int
+		threshold float64
+		want      v1.ConditionStatus
+		wantReason string
+	}{
+		{"well under threshold", 10, 100, 0.8, v1.ConditionFalse, "ok"},
+		{"just under threshold", 79, 100, 0.8, v1.ConditionFalse, "ok"},
+		{"at threshold", 80, 100, 0.8, v1.ConditionTrue, "pressure"},
+		{"over threshold", 95, 100, 0.8, v1.ConditionTrue, "pressure"},
+		{"no capacity reported", 0, 0, 0.8, v1.ConditionFalse, "ok"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := pressureCondition("MemoryPressure", c.used, c.total, c.threshold, "okReason", "okMessage", "pressureReason", "pressureMessage")
+			if got.Status != c.want {
+				t.Errorf("pressureCondition(used=%d, total=%d, threshold=%v).Status = %v, want %v", c.used, c.total, c.threshold, got.Status, c.want)
+			}
+
+			wantReason := "okReason"
+			if c.wantReason == "pressure" {
+				wantReason = "pressureReason"
+			}
+			if got.Reason != wantReason {
+				t.Errorf("pressureCondition(...).Reason = %q, want %q", got.Reason, wantReason)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package openstack
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/container/v1/capsules"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestRestartPolicyToZun(t *testing.T) {
+	cases := []struct {
+		name string
+		pod  *v1.Pod
+		want string
+	}{
+		{
+			name: "always",
+			pod:  &v1.Pod{Spec: v1.PodSpec{RestartPolicy: v1.RestartPolicyAlways}},
+			want: "always",
+		},
+		{
+			name: "never",
+			pod:  &v1.Pod{Spec: v1.PodSpec{RestartPolicy: v1.RestartPolicyNever}},
+			want: "no",
+		},
+		{
+			name: "on-failure defaults max restarts",
+			pod:  &v1.Pod{Spec: v1.PodSpec{RestartPolicy: v1.RestartPolicyOnFailure}},
+			want: "on-failure:" + defaultMaxRestarts,
+		},
+		{
+			name: "on-failure honors max-restarts annotation",
+			pod: &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{maxRestartsAnnotation: "7"}},
+				Spec:       v1.PodSpec{RestartPolicy: v1.RestartPolicyOnFailure},
+			},
+			want: "on-failure:7",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := restartPolicyToZun(c.pod); got != c.want {
+				t.Errorf("restartPolicyToZun() = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestProbeToHealthcheck(t *testing.T) {
+	cases := []struct {
+		name      string
+		container v1.Container
+		want      *capsules.Healthcheck
+	}{
+		{
+			name:      "no probes",
+			container: v1.Container{},
+			want:      nil,
+		},
+		{
+			name: "exec liveness probe",
+			container: v1.Container{
+				LivenessProbe: &v1.Probe{
+					Handler:             v1.Handler{Exec: &v1.ExecAction{Command: []string{"cat", "/tmp/healthy"}}},
+					PeriodSeconds:       10,
+					TimeoutSeconds:      5,
+					FailureThreshold:    3,
+					InitialDelaySeconds: 15,
+				},
+			},
+			want: &capsules.Healthcheck{
+				Test:        []string{"CMD", "cat", "/tmp/healthy"},
+				Interval:    10,
+				Timeout:     5,
+				Retries:     3,
+				StartPeriod: 15,
+			},
+		},
+		{
+			name: "liveness takes precedence over readiness",
+			container: v1.Container{
+				LivenessProbe:  &v1.Probe{Handler: v1.Handler{Exec: &v1.ExecAction{Command: []string{"true"}}}},
+				ReadinessProbe: &v1.Probe{Handler: v1.Handler{Exec: &v1.ExecAction{Command: []string{"false"}}}},
+			},
+			want: &capsules.Healthcheck{Test: []string{"CMD", "true"}},
+		},
+		{
+			name: "falls back to readiness probe",
+			container: v1.Container{
+				ReadinessProbe: &v1.Probe{Handler: v1.Handler{TCPSocket: &v1.TCPSocketAction{Port: intstr.FromInt(8080)}}},
+			},
+			want: &capsules.Healthcheck{Test: []string{"CMD", "nc", "-z", "localhost", "8080"}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := probeToHealthcheck(&c.container)
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("probeToHealthcheck() = %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestZunContainerReady(t *testing.T) {
+	cases := []struct {
+		name string
+		cs   capsules.Container
+		want bool
+	}{
+		{"not running", capsules.Container{Status: "Created"}, false},
+		{"running without healthcheck", capsules.Container{Status: "Running"}, true},
+		{"running and healthy", capsules.Container{Status: "Running", Healthcheck: &capsules.Healthcheck{Status: "healthy"}}, true},
+		{"running and unhealthy", capsules.Container{Status: "Running", Healthcheck: &capsules.Healthcheck{Status: "unhealthy"}}, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := zunContainerReady(&c.cs); got != c.want {
+				t.Errorf("zunContainerReady() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
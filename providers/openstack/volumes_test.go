@@ -0,0 +1,169 @@
+package openstack
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestVolumeCacheKey(t *testing.T) {
+	pod := &v1.Pod{}
+	pod.Namespace = "default"
+	pod.Name = "my-pod"
+
+	got := volumeCacheKey(pod, "data")
+	want := "default/my-pod/data"
+	if got != want {
+		t.Errorf("volumeCacheKey() = %q, want %q", got, want)
+	}
+}
+
+func TestPvcSizeGB(t *testing.T) {
+	cases := []struct {
+		name string
+		pvc  *v1.PersistentVolumeClaim
+		want int
+	}{
+		{
+			name: "no storage request falls back to default",
+			pvc:  &v1.PersistentVolumeClaim{},
+			want: defaultVolumeSizeGB,
+		},
+		{
+			name: "exact gibibyte request",
+			pvc: &v1.PersistentVolumeClaim{
+				Spec: v1.PersistentVolumeClaimSpec{
+					Resources: v1.ResourceRequirements{
+						Requests: v1.ResourceList{v1.ResourceStorage: resource.MustParse("5Gi")},
+					},
+				},
+			},
+			want: 5,
+		},
+		{
+			name: "sub-gibibyte request rounds up to 1",
+			pvc: &v1.PersistentVolumeClaim{
+				Spec: v1.PersistentVolumeClaimSpec{
+					Resources: v1.ResourceRequirements{
+						Requests: v1.ResourceList{v1.ResourceStorage: resource.MustParse("200Mi")},
+					},
+				},
+			},
+			want: 1,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := pvcSizeGB(c.pvc); got != c.want {
+				t.Errorf("pvcSizeGB() = %d, want %d", got, c.want)
+			}
+		})
+	}
+}
+
+func newTestZunProvider() *ZunProvider {
+	return &ZunProvider{
+		volumeCache: make(map[string]string),
+	}
+}
+
+// TestEnsureVolumesForPodRollsBackOnFailure verifies that when a later
+// volume in a Pod fails to provision, every volume created earlier in the
+// same ensureVolumesForPod call is deleted again and dropped from
+// p.volumeCache - the fix for the Cinder-volume-orphaning bug described in
+// the chunk0-2 review comment.
+func TestEnsureVolumesForPodRollsBackOnFailure(t *testing.T) {
+	origCreate, origDelete := cinderCreate, cinderDelete
+	defer func() { cinderCreate, cinderDelete = origCreate, origDelete }()
+
+	var mu sync.Mutex
+	deleted := map[string]int{}
+	created := 0
+
+	cinderCreate = func(client *gophercloud.ServiceClient, opts volumes.CreateOptsBuilder) (*volumes.Volume, error) {
+		created++
+		if created == 2 {
+			return nil, fmt.Errorf("boom")
+		}
+		return &volumes.Volume{ID: fmt.Sprintf("vol-%d", created)}, nil
+	}
+	cinderDelete = func(client *gophercloud.ServiceClient, id string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		deleted[id]++
+		return nil
+	}
+
+	p := newTestZunProvider()
+	pod := &v1.Pod{
+		Spec: v1.PodSpec{
+			Volumes: []v1.Volume{
+				{Name: "vol1", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+				{Name: "vol2", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+			},
+		},
+	}
+	pod.Namespace = "default"
+	pod.Name = "my-pod"
+
+	_, _, err := p.ensureVolumesForPod(pod)
+	if err == nil {
+		t.Fatal("expected ensureVolumesForPod to fail on the second volume")
+	}
+
+	if deleted["vol-1"] != 1 {
+		t.Errorf("deleted[vol-1] = %d, want 1 (the first volume should be rolled back)", deleted["vol-1"])
+	}
+	if len(p.volumeCache) != 0 {
+		t.Errorf("volumeCache = %+v, want empty after rollback", p.volumeCache)
+	}
+}
+
+// TestEnsureVolumesForPodReusesCachedVolume verifies that a retried call
+// for the same Pod reuses a volume UUID already recorded in p.volumeCache
+// instead of provisioning (and orphaning) a new one under the same name.
+func TestEnsureVolumesForPodReusesCachedVolume(t *testing.T) {
+	origCreate := cinderCreate
+	defer func() { cinderCreate = origCreate }()
+
+	created := 0
+	cinderCreate = func(client *gophercloud.ServiceClient, opts volumes.CreateOptsBuilder) (*volumes.Volume, error) {
+		created++
+		return &volumes.Volume{ID: fmt.Sprintf("vol-%d", created)}, nil
+	}
+
+	p := newTestZunProvider()
+	pod := &v1.Pod{
+		Spec: v1.PodSpec{
+			Volumes: []v1.Volume{
+				{Name: "vol1", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+			},
+		},
+	}
+	pod.Namespace = "default"
+	pod.Name = "my-pod"
+
+	volumeIDs, _, err := p.ensureVolumesForPod(pod)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Simulate a retried CreatePod for the same Pod.
+	retryVolumeIDs, _, err := p.ensureVolumesForPod(pod)
+	if err != nil {
+		t.Fatalf("unexpected error on retry: %s", err)
+	}
+
+	if created != 1 {
+		t.Errorf("createVolume was called %d times, want 1 (the retry should reuse the cached volume)", created)
+	}
+	if retryVolumeIDs["vol1"] != volumeIDs["vol1"] {
+		t.Errorf("retry volumeID = %q, want the original %q to be reused", retryVolumeIDs["vol1"], volumeIDs["vol1"])
+	}
+}
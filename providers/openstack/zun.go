@@ -1,27 +1,73 @@
 package openstack
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
+	"net/http"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack"
 	"github.com/gophercloud/gophercloud/pagination"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
 	"github.com/gophercloud/gophercloud/openstack/container/v1/capsules"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/floatingips"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/lbaas_v2/listeners"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/lbaas_v2/loadbalancers"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/lbaas_v2/pools"
 	"github.com/virtual-kubelet/virtual-kubelet/manager"
 	"github.com/virtual-kubelet/virtual-kubelet/providers"
 	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sync"
 )
 
+// podLBWaitTimeout bounds each wait CreatePod makes for Octavia to finish
+// provisioning a load balancer; on timeout CreatePod fails.
+const podLBWaitTimeout = 2 * time.Minute
+
+// defaultVolumeSizeGB is used for EmptyDir and ConfigMap/Secret backed
+// Cinder volumes, which carry no size request of their own.
+const defaultVolumeSizeGB = 1
+
+// volumeDriverCinder and volumeDriverManila are the supported values for
+// the "OS_VOLUME_DRIVER" operator knob (see p.volumeDriver).
+const (
+	volumeDriverCinder = "cinder"
+	volumeDriverManila = "manila"
+)
+
+// annotationLabelPrefix is prepended to a Pod annotation's key when it is
+// round-tripped through a capsule's MetaLabels, so capsuleToPod can tell
+// a passed-through annotation apart from virtual-kubelet's own bookkeeping
+// labels (PodName, Namespace, UID, ...).
+const annotationLabelPrefix = "io.kubernetes.annotation."
+
+// maxRestartsAnnotation lets an operator cap the restart count Zun will
+// apply to a Pod with RestartPolicy "OnFailure" (Zun has no equivalent of
+// Kubernetes' unbounded on-failure restarts).
+const maxRestartsAnnotation = "virtual-kubelet.io/max-restarts"
+
+// defaultMaxRestarts is used when maxRestartsAnnotation isn't set on a Pod
+// with RestartPolicy "OnFailure".
+const defaultMaxRestarts = "3"
+
 // ZunProvider implements the virtual-kubelet provider interface and communicates with OpenStack's Zun APIs.
 type ZunProvider struct {
 	ZunClient          *gophercloud.ServiceClient
+	NetworkClient      *gophercloud.ServiceClient
+	BlockStorageClient *gophercloud.ServiceClient
+	ComputeClient      *gophercloud.ServiceClient
 	resourceManager    *manager.ResourceManager
 	region             string
 	nodeName           string
@@ -30,6 +76,29 @@ type ZunProvider struct {
 	memory             string
 	pods               string
 	daemonEndpointPort int32
+
+	// volumeDriver names the backend for PersistentVolumeClaim/EmptyDir
+	// volumes: "cinder" (block storage, the default) or "manila" (NFS
+	// shares). createVolume provisions Cinder volumes for both values; a
+	// "manila" setting is only logged.
+	volumeDriver string
+
+	// volumeCacheMu guards volumeCache.
+	volumeCacheMu sync.Mutex
+	// volumeCache maps "namespace/pod/volumeName" to the Cinder/Manila
+	// volume UUID backing it, so DeletePod can clean up without having to
+	// re-derive sizes/types from a Pod spec that may no longer exist.
+	volumeCache map[string]string
+
+	// podCache serves GetPod/GetPods/GetPodStatus from a periodically
+	// resynced, indexed view of this node's capsules instead of hitting
+	// Zun on every call.
+	podCache *podCache
+
+	// nodeInfo serves Capacity/NodeConditions/NodeAddresses from a
+	// periodically resynced view of the Nova hypervisor backing this
+	// node, instead of the hard-coded always-healthy defaults.
+	nodeInfo *nodeInfo
 }
 
 // NewZunProvider creates a new ZunProvider.
@@ -59,6 +128,22 @@ func NewZunProvider(config string, rm *manager.ResourceManager, nodeName, operat
 		return nil, err
 	}
 
+	p.NetworkClient, err = openstack.NewNetworkV2(Provider, gophercloud.EndpointOpts{
+		Region: os.Getenv("OS_REGION_NAME"),
+	})
+	if err != nil {
+		fmt.Errorf("Unable to get neutron client")
+		return nil, err
+	}
+
+	p.BlockStorageClient, err = openstack.NewBlockStorageV3(Provider, gophercloud.EndpointOpts{
+		Region: os.Getenv("OS_REGION_NAME"),
+	})
+	if err != nil {
+		fmt.Errorf("Unable to get cinder client")
+		return nil, err
+	}
+
 	// Set sane defaults for Capacity in case config is not supplied
 	p.cpu = "20"
 	p.memory = "100Gi"
@@ -68,12 +153,43 @@ func NewZunProvider(config string, rm *manager.ResourceManager, nodeName, operat
 	p.nodeName = nodeName
 	p.daemonEndpointPort = daemonEndpointPort
 
+	p.volumeDriver = os.Getenv("OS_VOLUME_DRIVER")
+	if p.volumeDriver == "" {
+		p.volumeDriver = volumeDriverCinder
+	}
+	p.volumeCache = make(map[string]string)
+
+	p.ComputeClient, err = openstack.NewComputeV2(Provider, gophercloud.EndpointOpts{
+		Region: os.Getenv("OS_REGION_NAME"),
+	})
+	if err != nil {
+		fmt.Errorf("Unable to get nova client")
+		return nil, err
+	}
+
+	p.podCache = newPodCache(p.ZunClient, p.nodeName, defaultPodCacheResyncInterval)
+	p.podCache.run()
+
+	p.nodeInfo = newNodeInfo(p.ComputeClient, defaultPodCacheResyncInterval)
+	p.nodeInfo.run()
+
 	return &p, err
 }
 
+// PodChanges returns a channel of pods whose status changed on the most
+// recent cache resync, so callers can subscribe to pushed updates instead
+// of polling GetPod/GetPods.
+func (p *ZunProvider) PodChanges() <-chan *v1.Pod {
+	return p.podCache.changesChan()
+}
+
 // GetPod returns a pod by name that is running inside ACI
 // returns nil if a pod by that name is not found.
 func (p *ZunProvider) GetPod(namespace, name string) (*v1.Pod, error) {
+	if pod := p.podCache.get(namespace, name); pod != nil {
+		return pod, nil
+	}
+
 	capsule, err := capsules.Get(p.ZunClient, fmt.Sprintf("%s-%s", namespace, name)).Extract()
 	if err != nil {
 		return nil, err
@@ -88,6 +204,14 @@ func (p *ZunProvider) GetPod(namespace, name string) (*v1.Pod, error) {
 
 // GetPods returns a list of all pods known to be running within ACI.
 func (p *ZunProvider) GetPods() ([]*v1.Pod, error) {
+	// len(list()) == 0 doesn't distinguish "cache hasn't synced yet" from
+	// "node genuinely has no pods", so an idle node would never trust the
+	// cache and would fall through to a live Zun list on every call.
+	// hasSynced is the real cache-miss signal.
+	if p.podCache.hasSynced() {
+		return p.podCache.list(), nil
+	}
+
         pager := capsules.List(p.ZunClient, nil)
 
 	pages := 0
@@ -128,10 +252,26 @@ func (p *ZunProvider) GetPods() ([]*v1.Pod, error) {
 
 // CreatePod accepts a Pod definition and creates
 // an Zun deployment
-func (p *ZunProvider) CreatePod(pod *v1.Pod) error {
+func (p *ZunProvider) CreatePod(pod *v1.Pod) (err error) {
+	// If anything past this point fails, tear back down whatever of the
+	// volumes/load-balancer this call itself provisioned rather than
+	// leaving them dangling for a retried CreatePod to duplicate.
+	serviceCreated := false
+	defer func() {
+		if err == nil {
+			return
+		}
+		if serviceCreated {
+			if derr := p.deleteServiceForPod(pod); derr != nil {
+				log.Println(derr)
+			}
+		}
+		p.cleanupVolumesForPod(pod)
+	}()
+
 	//capsuleTemplate := new(capsules.Template)
 	var capsule capsules.Capsule
-	capsule.RestartPolicy = pod.Spec.RestartPolicy
+	capsule.RestartPolicy = restartPolicyToZun(pod)
 	capsule.CapsuleVersion = "beta"
 
 	podUID := string(pod.UID)
@@ -144,29 +284,275 @@ func (p *ZunProvider) CreatePod(pod *v1.Pod) error {
 		"UID":               podUID,
 		"CreationTimestamp": podCreationTimestamp,
 	}
-	capsule.MetaName = pod.Namespace + '-' + pod.Name
+	capsule.MetaName = fmt.Sprintf("%s-%s", pod.Namespace, pod.Name)
+
+	// Round-trip the Pod's annotations through Zun metadata labels, the
+	// same way podman's kube generate/play round-trips auto-update labels
+	// through annotations, so tools like auto-updaters see their
+	// annotations survive a round trip via capsuleToPod.
+	for k, v := range pod.Annotations {
+		capsule.MetaLabels[annotationLabelPrefix+k] = v
+	}
+
 
+	// Provision the backing storage for every Volume this Pod references
+	// before we touch a single container, since VolumeMounts need the
+	// resulting volume UUIDs to attach correctly.
+	volumeIDs, volumeFiles, err := p.ensureVolumesForPod(pod)
+	if err != nil {
+		return err
+	}
 
 	// get containers
-	containers, err := p.getContainers(pod)
+	containers, err := p.getContainers(pod, volumeIDs, volumeFiles)
 	if err != nil {
 		return err
 	}
 
 	// assign all the things
-	capsules.Capsule.Containers = containers
+	capsule.Containers = containers
+
+	// Collect the ports this Pod exposes so we can stand up a matching
+	// Neutron/Octavia load balancer (or a plain floating IP when there is
+	// nothing to load-balance across) and surface the allocated address
+	// back onto the capsule metadata.
+	servicePorts := podToServicePorts(pod)
+	if len(servicePorts) > 0 {
+		vip, serviceErr := p.ensureServiceForPod(pod, servicePorts)
+		// ensureServiceForPod can fail after it has already created the
+		// load balancer, so the teardown above applies in that case too.
+		serviceCreated = true
+		if serviceErr != nil {
+			err = serviceErr
+			return err
+		}
+		capsule.MetaLabels["ServiceVIP"] = vip
+	}
+
+	_, err = capsules.Create(p.ZunClient, capsule).Extract()
+	if err != nil {
+		err = fmt.Errorf("unable to create capsule for pod %s/%s: %s", pod.Namespace, pod.Name, err)
+		return err
+	}
+
+	return nil
+}
+
+// podToServicePorts collects every container port a Pod exposes into the
+// []v1.ServicePort shape, mirroring the pod-plus-ServicePort return pattern
+// podman's kube play/generate code uses when it walks a Pod's containers.
+func podToServicePorts(pod *v1.Pod) []v1.ServicePort {
+	var ports []v1.ServicePort
+	for _, container := range pod.Spec.Containers {
+		for _, cp := range container.Ports {
+			ports = append(ports, v1.ServicePort{
+				Name:       fmt.Sprintf("%s-%d", container.Name, cp.ContainerPort),
+				Port:       cp.ContainerPort,
+				TargetPort: intOrStringFromInt32(cp.ContainerPort),
+				Protocol:   cp.Protocol,
+			})
+		}
+	}
+	return ports
+}
+
+// ensureServiceForPod drives creation of a Neutron/Octavia load balancer
+// fronting the given ServicePorts and returns the allocated VIP (a floating
+// IP is associated with the LB's VIP port so the address is reachable from
+// outside the tenant network). It is the counterpart to the teardown done
+// in DeletePod.
+func (p *ZunProvider) ensureServiceForPod(pod *v1.Pod, servicePorts []v1.ServicePort) (string, error) {
+	lbName := fmt.Sprintf("%s-%s", pod.Namespace, pod.Name)
+
+	lb, err := loadbalancers.Create(p.NetworkClient, loadbalancers.CreateOpts{
+		Name:         lbName,
+		Description:  fmt.Sprintf("virtual-kubelet service LB for %s", lbName),
+		VipSubnetID:  os.Getenv("OS_POD_SUBNET_ID"),
+		AdminStateUp: gophercloud.Enabled,
+	}).Extract()
+	if err != nil {
+		return "", fmt.Errorf("unable to create load balancer for pod %s: %s", lbName, err)
+	}
 
-	// TODO(BJK) containergrouprestartpolicy??
-	_, err = p.aciClient.CreateContainerGroup(
-		p.resourceGroup,
-		fmt.Sprintf("%s-%s", pod.Namespace, pod.Name),
-		containerGroup,
-	)
+	if err := waitForLoadBalancer(p.NetworkClient, lb.ID, podLBWaitTimeout); err != nil {
+		return "", err
+	}
 
-	return err
+	for _, sp := range servicePorts {
+		listener, err := listeners.Create(p.NetworkClient, listeners.CreateOpts{
+			Name:           fmt.Sprintf("%s-%d", lbName, sp.Port),
+			Protocol:       listeners.Protocol(getProtocol(sp.Protocol)),
+			ProtocolPort:   int(sp.Port),
+			LoadbalancerID: lb.ID,
+		}).Extract()
+		if err != nil {
+			return "", fmt.Errorf("unable to create listener for pod %s port %d: %s", lbName, sp.Port, err)
+		}
+		if err := waitForLoadBalancer(p.NetworkClient, lb.ID, podLBWaitTimeout); err != nil {
+			return "", err
+		}
+
+		_, err = pools.Create(p.NetworkClient, pools.CreateOpts{
+			Name:       fmt.Sprintf("%s-%d", lbName, sp.Port),
+			Protocol:   pools.Protocol(getProtocol(sp.Protocol)),
+			LBMethod:   pools.LBMethodRoundRobin,
+			ListenerID: listener.ID,
+		}).Extract()
+		if err != nil {
+			return "", fmt.Errorf("unable to create pool for pod %s port %d: %s", lbName, sp.Port, err)
+		}
+		if err := waitForLoadBalancer(p.NetworkClient, lb.ID, podLBWaitTimeout); err != nil {
+			return "", err
+		}
+	}
+
+	fip, err := floatingips.Create(p.NetworkClient, floatingips.CreateOpts{
+		FloatingNetworkID: os.Getenv("OS_FLOATING_NETWORK_ID"),
+		PortID:            lb.VipPortID,
+	}).Extract()
+	if err != nil {
+		// No external network configured for this deployment; fall back to
+		// reporting the LB's internal VIP so in-cluster traffic still works.
+		return lb.VipAddress, nil
+	}
+
+	return fip.FloatingIP, nil
+}
+
+// waitForLoadBalancer polls an Octavia load balancer until it leaves the
+// PENDING_* provisioning states, since listeners/pools/members cannot be
+// attached to a load balancer that is still being provisioned.
+func waitForLoadBalancer(client *gophercloud.ServiceClient, id string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		lb, err := loadbalancers.Get(client, id).Extract()
+		if err != nil {
+			return err
+		}
+		if lb.ProvisioningStatus == "ACTIVE" || lb.ProvisioningStatus == "ERROR" {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for load balancer %s to become ACTIVE", id)
+		}
+		time.Sleep(time.Second)
+	}
 }
 
-func (p *ZunProvider) getContainers(pod *v1.Pod) ([]capsules.Container, error) {
+// deleteServiceForPod tears down the load balancer (and any floating IP
+// bound to its VIP) that ensureServiceForPod created for this pod.
+func (p *ZunProvider) deleteServiceForPod(pod *v1.Pod) error {
+	lbName := fmt.Sprintf("%s-%s", pod.Namespace, pod.Name)
+
+	pager := loadbalancers.List(p.NetworkClient, loadbalancers.ListOpts{Name: lbName})
+	return pager.EachPage(func(page pagination.Page) (bool, error) {
+		lbs, err := loadbalancers.ExtractLoadBalancers(page)
+		if err != nil {
+			return false, err
+		}
+		for _, lb := range lbs {
+			fipPager := floatingips.List(p.NetworkClient, floatingips.ListOpts{PortID: lb.VipPortID})
+			err := fipPager.EachPage(func(fipPage pagination.Page) (bool, error) {
+				fips, err := floatingips.ExtractFloatingIPs(fipPage)
+				if err != nil {
+					return false, err
+				}
+				for _, fip := range fips {
+					if err := floatingips.Delete(p.NetworkClient, fip.ID).ExtractErr(); err != nil {
+						log.Println(err)
+					}
+				}
+				return true, nil
+			})
+			if err != nil {
+				log.Println(err)
+			}
+			if err := loadbalancers.Delete(p.NetworkClient, lb.ID, loadbalancers.DeleteOpts{Cascade: true}).ExtractErr(); err != nil {
+				log.Println(err)
+			}
+		}
+		return true, nil
+	})
+}
+
+func intOrStringFromInt32(port int32) intstr.IntOrString {
+	return intstr.FromInt(int(port))
+}
+
+// getProtocol maps a Kubernetes container port protocol to the string Zun
+// (and Neutron/Octavia) expect; Zun defaults to TCP for anything it does
+// not recognize.
+func getProtocol(protocol v1.Protocol) string {
+	switch protocol {
+	case v1.ProtocolUDP:
+		return "udp"
+	case v1.ProtocolSCTP:
+		return "sctp"
+	default:
+		return "tcp"
+	}
+}
+
+// restartPolicyToZun maps a Pod's RestartPolicy to the string Zun's
+// restart_policy capsule field expects: Always -> "always", Never -> "no",
+// and OnFailure -> "on-failure:N" where N comes from maxRestartsAnnotation
+// (defaultMaxRestarts if unset).
+func restartPolicyToZun(pod *v1.Pod) string {
+	switch pod.Spec.RestartPolicy {
+	case v1.RestartPolicyAlways:
+		return "always"
+	case v1.RestartPolicyNever:
+		return "no"
+	case v1.RestartPolicyOnFailure:
+		maxRestarts := pod.Annotations[maxRestartsAnnotation]
+		if maxRestarts == "" {
+			maxRestarts = defaultMaxRestarts
+		}
+		return fmt.Sprintf("on-failure:%s", maxRestarts)
+	default:
+		return "always"
+	}
+}
+
+// probeToHealthcheck translates a Kubernetes probe into a Zun capsule
+// Healthcheck. Liveness takes precedence over readiness when a container
+// defines both, since Zun only models a single healthcheck per container.
+func probeToHealthcheck(container *v1.Container) *capsules.Healthcheck {
+	probe := container.LivenessProbe
+	if probe == nil {
+		probe = container.ReadinessProbe
+	}
+	if probe == nil {
+		return nil
+	}
+
+	var test []string
+	switch {
+	case probe.Exec != nil:
+		test = append([]string{"CMD"}, probe.Exec.Command...)
+	case probe.HTTPGet != nil:
+		scheme := "http"
+		if probe.HTTPGet.Scheme == v1.URISchemeHTTPS {
+			scheme = "https"
+		}
+		port := probe.HTTPGet.Port.String()
+		test = []string{"CMD", "curl", "-f", fmt.Sprintf("%s://localhost:%s%s", scheme, port, probe.HTTPGet.Path)}
+	case probe.TCPSocket != nil:
+		test = []string{"CMD", "nc", "-z", "localhost", probe.TCPSocket.Port.String()}
+	default:
+		return nil
+	}
+
+	return &capsules.Healthcheck{
+		Test:       test,
+		Interval:   int(probe.PeriodSeconds),
+		Timeout:    int(probe.TimeoutSeconds),
+		Retries:    int(probe.FailureThreshold),
+		StartPeriod: int(probe.InitialDelaySeconds),
+	}
+}
+
+func (p *ZunProvider) getContainers(pod *v1.Pod, volumeIDs map[string]string, volumeFiles map[string]map[string]string) ([]capsules.Container, error) {
 	containers := make([]capsules.Container, 0, len(pod.Spec.Containers))
 	for _, container := range pod.Spec.Containers {
 		c := capsules.Container{
@@ -183,12 +569,12 @@ func (p *ZunProvider) getContainers(pod *v1.Pod) ([]capsules.Container, error) {
 		}
 
 		if container.Resources.Limits != nil {
-		//	cpuLimit := cpuRequest
+			var cpuLimit, memoryLimit float64
+
 			if _, ok := container.Resources.Limits[v1.ResourceCPU]; ok {
 				cpuLimit = float64(container.Resources.Limits.Cpu().MilliValue()) / 1000.00
 			}
 
-		//	memoryLimit := memoryRequest
 			if _, ok := container.Resources.Limits[v1.ResourceMemory]; ok {
 				memoryLimit = float64(container.Resources.Limits.Memory().Value()) / 1000000000.00
 			}
@@ -222,23 +608,37 @@ func (p *ZunProvider) getContainers(pod *v1.Pod) ([]capsules.Container, error) {
 		//			},
 		//		}
 
-		//Sync Port with container
-		//		for _, p := range container.Ports {
-		//			c.Ports = append(c.Ports, aci.ContainerPort{
-		//				Port:     p.ContainerPort,
-		//				Protocol: getProtocol(p.Protocol),
-		//			})
-		//		}
+		// Sync Port with container
+		for _, cp := range container.Ports {
+			c.Ports = append(c.Ports, fmt.Sprintf("%d/%s", cp.ContainerPort, getProtocol(cp.Protocol)))
+		}
 
-		//Add later for volume
-		//		c.VolumeMounts = make([]aci.VolumeMount, 0, len(container.VolumeMounts))
-		//		for _, v := range container.VolumeMounts {
-		//			c.VolumeMounts = append(c.VolumeMounts, aci.VolumeMount{
-		//				Name:      v.Name,
-		//				MountPath: v.MountPath,
-		//				ReadOnly:  v.ReadOnly,
-		//			})
-		//		}
+		c.Healthcheck = probeToHealthcheck(&container)
+
+		// Sync VolumeMounts with the Cinder/Manila volume ensureVolumesForPod
+		// already provisioned for each Volume this container references.
+		// ConfigMap/Secret volumes that were materialized as inline capsule
+		// files instead get injected directly via c.Files.
+		c.VolumeMounts = make([]capsules.VolumeMount, 0, len(container.VolumeMounts))
+		c.Files = map[string]string{}
+		for _, v := range container.VolumeMounts {
+			if files, ok := volumeFiles[v.Name]; ok {
+				for name, content := range files {
+					c.Files[v.MountPath+"/"+name] = content
+				}
+				continue
+			}
+
+			volumeID, ok := volumeIDs[v.Name]
+			if !ok {
+				continue
+			}
+			c.VolumeMounts = append(c.VolumeMounts, capsules.VolumeMount{
+				MountPath: v.MountPath,
+				ReadOnly:  v.ReadOnly,
+				VolumeID:  volumeID,
+			})
+		}
 		containers = append(containers, c)
 	}
 	return containers, nil
@@ -259,14 +659,113 @@ func (p *ZunProvider) GetPodStatus(namespace, name string) (*v1.PodStatus, error
 	return &pod.Status, nil
 }
 
+// LogOptions controls what GetContainerLogsStream asks Zun's
+// /containers/{id}/logs endpoint for. It is modelled after the options
+// struct backing podman's compat /containers/{id}/logs handler.
+type LogOptions struct {
+	Follow     bool
+	Since      time.Time
+	Tail       string // a positive count, or "all"
+	Timestamps bool
+}
+
+// tailOption converts the plain line count GetContainerLogs takes into the
+// string Zun's logs endpoint expects: "all" for a non-positive count (i.e.
+// "don't limit"), otherwise the count itself.
+func tailOption(tail int) string {
+	if tail > 0 {
+		return strconv.Itoa(tail)
+	}
+	return "all"
+}
+
+// GetContainerLogs returns the logs for a container within a pod. It
+// resolves the capsule from "namespace-podName", finds containerName
+// inside it, and fetches up to `tail` lines of stdout/stderr from Zun.
 func (p *ZunProvider) GetContainerLogs(namespace, podName, containerName string, tail int) (string, error) {
-	return "not support in Zun Provider", nil
+	rc, err := p.GetContainerLogsStream(context.Background(), namespace, podName, containerName, LogOptions{
+		Tail: tailOption(tail),
+	})
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	logs, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return "", err
+	}
+
+	return string(logs), nil
+}
+
+// GetContainerLogsStream streams the logs for a container within a pod,
+// so that e.g. `kubectl logs -f` can follow them as they are produced.
+// The returned ReadCloser must be closed by the caller.
+func (p *ZunProvider) GetContainerLogsStream(ctx context.Context, namespace, podName, containerName string, opts LogOptions) (io.ReadCloser, error) {
+	capsule, err := capsules.Get(p.ZunClient, fmt.Sprintf("%s-%s", namespace, podName)).Extract()
+	if err != nil {
+		return nil, err
+	}
+
+	var containerID string
+	for _, c := range capsule.Containers {
+		if c.Name == containerName {
+			containerID = c.ContainerID
+			break
+		}
+	}
+	if containerID == "" {
+		return nil, fmt.Errorf("no container named %s found in pod %s/%s", containerName, namespace, podName)
+	}
+
+	query := url.Values{}
+	query.Set("stdout", "true")
+	query.Set("stderr", "true")
+	query.Set("timestamps", strconv.FormatBool(opts.Timestamps))
+	query.Set("follow", strconv.FormatBool(opts.Follow))
+	if opts.Tail != "" {
+		query.Set("tail", opts.Tail)
+	}
+	if !opts.Since.IsZero() {
+		query.Set("since", strconv.FormatInt(opts.Since.Unix(), 10))
+	}
+
+	logsURL := p.ZunClient.ServiceURL("containers", containerID, "logs") + "?" + query.Encode()
+
+	req, err := http.NewRequest("GET", logsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("X-Auth-Token", p.ZunClient.TokenID)
+
+	// Use the underlying HTTP client directly (rather than
+	// gophercloud.ServiceClient.Request) so the response body can be
+	// streamed back to the caller in chunks instead of being buffered.
+	resp, err := p.ZunClient.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("zun logs request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	return resp.Body, nil
 }
 
 // NodeConditions returns a list of conditions (Ready, OutOfDisk, etc), for updates to the node status
-// within Kubernetes.
+// within Kubernetes. It reports the last set resynced from Nova by
+// p.nodeInfo; if that has never succeeded (e.g. the Nova call is failing),
+// it falls back to the original hard-coded always-healthy defaults so the
+// node still reports Ready.
 func (p *ZunProvider) NodeConditions() []v1.NodeCondition {
-	// TODO: Make these dynamic and augment with custom ACI specific conditions of interest
+	if conditions, ok := p.nodeInfo.getConditions(); ok {
+		return conditions
+	}
+
 	return []v1.NodeCondition{
 		{
 			Type:               "Ready",
@@ -314,7 +813,7 @@ func (p *ZunProvider) NodeConditions() []v1.NodeCondition {
 // NodeAddresses returns a list of addresses for the node status
 // within Kubernetes.
 func (p *ZunProvider) NodeAddresses() []v1.NodeAddress {
-	return nil
+	return p.nodeInfo.getAddresses()
 }
 
 // NodeDaemonEndpoints returns NodeDaemonEndpoints for the node status
@@ -373,7 +872,7 @@ func capsuleToPod(capsule *capsules.Capsule) (*v1.Pod, error) {
 			State:                zunContainerStausToContainerStatus(&c),
 			//Zun doesn't record termination state.
 			LastTerminationState: zunContainerStausToContainerStatus(&c),
-			Ready:                zunStatusToPodPhase(c.Status) == v1.PodRunning,
+			Ready:                zunContainerReady(&c),
 			//Zun doesn't record restartCount.
 			RestartCount:         int32(0),
 			Image:                c.Image,
@@ -396,6 +895,26 @@ func capsuleToPod(capsule *capsules.Capsule) (*v1.Pod, error) {
 		}
 	}
 
+	// The Service VIP (floating IP or LB VIP) allocated by
+	// ensureServiceForPod is stashed on the capsule metadata at create
+	// time; report it as the node-facing HostIP. If the capsule has no
+	// fixed IP of its own yet, fall back to the VIP for PodIP too.
+	hostIP := capsule.MetaLabels["ServiceVIP"]
+	podIP := ip
+	if podIP == "" {
+		podIP = hostIP
+	}
+
+	// Surface any Pod annotations that were round-tripped through the
+	// capsule's metadata labels at create time (see CreatePod), so tools
+	// like auto-updaters see their annotations survive a round trip.
+	annotations := map[string]string{}
+	for k, v := range capsule.MetaLabels {
+		if strings.HasPrefix(k, annotationLabelPrefix) {
+			annotations[strings.TrimPrefix(k, annotationLabelPrefix)] = v
+		}
+	}
+
 	p := v1.Pod{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "Pod",
@@ -407,6 +926,7 @@ func capsuleToPod(capsule *capsules.Capsule) (*v1.Pod, error) {
 			ClusterName:       capsule.MetaLabels["ClusterName"],
 			UID:               types.UID(capsule.UUID),
 			CreationTimestamp: podCreationTimestamp,
+			Annotations:       annotations,
 		},
 		Spec: v1.PodSpec{
 			NodeName:   capsule.MetaLabels["NodeName"],
@@ -419,8 +939,8 @@ func capsuleToPod(capsule *capsules.Capsule) (*v1.Pod, error) {
 			Conditions:        []v1.PodCondition{},
 			Message:           "",
 			Reason:            "",
-			HostIP:            "",
-			PodIP:             ip,
+			HostIP:            hostIP,
+			PodIP:             podIP,
 			StartTime:         &containerStartTime,
 			ContainerStatuses: containerStatuses,
 		},
@@ -434,11 +954,248 @@ func (p *ZunProvider) UpdatePod(pod *v1.Pod) error {
 	return nil
 }
 
-// DeletePod deletes the specified pod out of Zun.
+// DeletePod deletes the specified pod out of Zun, along with any
+// load balancer/floating IP that was provisioned to expose its ports.
 func (p *ZunProvider) DeletePod(pod *v1.Pod) error {
+	if err := p.deleteServiceForPod(pod); err != nil {
+		log.Println(err)
+	}
+
+	p.cleanupVolumesForPod(pod)
+
 	return capsules.Delete(p.ZunClient, fmt.Sprintf("%s-%s", pod.Namespace, pod.Name)).ExtractErr()
 }
 
+// volumeCacheKey is the p.volumeCache key a given Pod Volume is stored
+// under: "namespace/pod/volumeName".
+func volumeCacheKey(pod *v1.Pod, volumeName string) string {
+	return fmt.Sprintf("%s/%s/%s", pod.Namespace, pod.Name, volumeName)
+}
+
+// ensureVolumesForPod walks pod.Spec.Volumes and provisions the backing
+// resource for each one before capsule creation:
+//
+//   - PersistentVolumeClaim/EmptyDir volumes become a Cinder volume
+//     (whatever p.volumeDriver says), sized from the PVC request for PVCs and
+//     defaultVolumeSizeGB for EmptyDir. The returned map is keyed by
+//     volume name and is consumed by getContainers to fill in
+//     capsules.Container.VolumeMounts. A volume already present in
+//     p.volumeCache (left over from an earlier, partially-failed
+//     CreatePod call for the same Pod) is reused rather than
+//     re-provisioned, since Cinder volume names aren't unique and a
+//     repeat create would just orphan the first one.
+//   - ConfigMap/Secret volumes are materialized as a set of
+//     filename->content pairs instead, for inline injection through Zun's
+//     file-injection API; these are returned separately since they never
+//     get a volume UUID of their own.
+func (p *ZunProvider) ensureVolumesForPod(pod *v1.Pod) (_ map[string]string, _ map[string]map[string]string, err error) {
+	volumeIDs := map[string]string{}
+	volumeFiles := map[string]map[string]string{}
+
+	// createdThisCall tracks only the volumes *this* call provisioned, as
+	// opposed to ones reused from p.volumeCache (see cachedVolume below).
+	// If a later volume in this Pod fails to provision, only these get
+	// rolled back - a volume reused from a previous, partially-failed
+	// CreatePod attempt must survive so the next retry can reuse it again
+	// instead of orphaning yet another Cinder volume under the same name.
+	createdThisCall := map[string]string{}
+	defer func() {
+		if err != nil {
+			for name, volumeID := range createdThisCall {
+				if delErr := p.deleteVolume(volumeID); delErr != nil {
+					log.Println(delErr)
+				}
+				p.forgetVolume(pod, name)
+			}
+		}
+	}()
+
+	for _, vol := range pod.Spec.Volumes {
+		switch {
+		case vol.PersistentVolumeClaim != nil:
+			if volumeID, ok := p.cachedVolume(pod, vol.Name); ok {
+				volumeIDs[vol.Name] = volumeID
+				continue
+			}
+
+			pvc, pvcErr := p.resourceManager.GetPersistentVolumeClaim(vol.PersistentVolumeClaim.ClaimName, pod.Namespace)
+			if pvcErr != nil {
+				err = fmt.Errorf("unable to get PVC %s for pod %s/%s: %s", vol.PersistentVolumeClaim.ClaimName, pod.Namespace, pod.Name, pvcErr)
+				return nil, nil, err
+			}
+
+			volumeID, createErr := p.createVolume(fmt.Sprintf("%s-%s-%s", pod.Namespace, pod.Name, vol.Name), pvcSizeGB(pvc))
+			if createErr != nil {
+				err = createErr
+				return nil, nil, err
+			}
+			volumeIDs[vol.Name] = volumeID
+			createdThisCall[vol.Name] = volumeID
+			p.rememberVolume(pod, vol.Name, volumeID)
+
+		case vol.EmptyDir != nil:
+			if volumeID, ok := p.cachedVolume(pod, vol.Name); ok {
+				volumeIDs[vol.Name] = volumeID
+				continue
+			}
+
+			volumeID, createErr := p.createVolume(fmt.Sprintf("%s-%s-%s", pod.Namespace, pod.Name, vol.Name), defaultVolumeSizeGB)
+			if createErr != nil {
+				err = createErr
+				return nil, nil, err
+			}
+			volumeIDs[vol.Name] = volumeID
+			createdThisCall[vol.Name] = volumeID
+			p.rememberVolume(pod, vol.Name, volumeID)
+
+		case vol.ConfigMap != nil:
+			cm, cmErr := p.resourceManager.GetConfigMap(vol.ConfigMap.Name, pod.Namespace)
+			if cmErr != nil {
+				err = fmt.Errorf("unable to get ConfigMap %s for pod %s/%s: %s", vol.ConfigMap.Name, pod.Namespace, pod.Name, cmErr)
+				return nil, nil, err
+			}
+			files := map[string]string{}
+			for k, v := range cm.Data {
+				files[k] = v
+			}
+			volumeFiles[vol.Name] = files
+
+		case vol.Secret != nil:
+			secret, secretErr := p.resourceManager.GetSecret(vol.Secret.SecretName, pod.Namespace)
+			if secretErr != nil {
+				err = fmt.Errorf("unable to get Secret %s for pod %s/%s: %s", vol.Secret.SecretName, pod.Namespace, pod.Name, secretErr)
+				return nil, nil, err
+			}
+			files := map[string]string{}
+			for k, v := range secret.Data {
+				files[k] = string(v)
+			}
+			volumeFiles[vol.Name] = files
+		}
+	}
+
+	return volumeIDs, volumeFiles, nil
+}
+
+// cinderCreate and cinderDelete wrap the gophercloud calls createVolume and
+// deleteVolume make. They're package-level vars, rather than direct calls,
+// purely so tests can stub them out without a real BlockStorageClient.
+var (
+	cinderCreate = func(client *gophercloud.ServiceClient, opts volumes.CreateOptsBuilder) (*volumes.Volume, error) {
+		return volumes.Create(client, opts).Extract()
+	}
+	cinderDelete = func(client *gophercloud.ServiceClient, id string) error {
+		return volumes.Delete(client, id, volumes.DeleteOpts{}).ExtractErr()
+	}
+)
+
+// createVolume provisions a single volume of the given size against
+// p.volumeDriver. Manila support is not wired up to gophercloud yet, so it
+// currently falls back to Cinder.
+func (p *ZunProvider) createVolume(name string, sizeGB int) (string, error) {
+	switch p.volumeDriver {
+	case volumeDriverManila:
+		log.Printf("manila volume driver requested for %s, falling back to cinder", name)
+		fallthrough
+	default:
+		vol, err := cinderCreate(p.BlockStorageClient, volumes.CreateOpts{
+			Name: name,
+			Size: sizeGB,
+		})
+		if err != nil {
+			return "", fmt.Errorf("unable to create cinder volume %s: %s", name, err)
+		}
+		return vol.ID, nil
+	}
+}
+
+// deleteVolume deletes a single volume previously returned by createVolume.
+func (p *ZunProvider) deleteVolume(volumeID string) error {
+	return cinderDelete(p.BlockStorageClient, volumeID)
+}
+
+// pvcSizeGB extracts the requested storage size, in whole gibibytes, from a
+// PersistentVolumeClaim, rounding up to at least 1 and falling back to
+// defaultVolumeSizeGB if the claim doesn't specify a storage request.
+func pvcSizeGB(pvc *v1.PersistentVolumeClaim) int {
+	request, ok := pvc.Spec.Resources.Requests[v1.ResourceStorage]
+	if !ok {
+		return defaultVolumeSizeGB
+	}
+	const gib = 1024 * 1024 * 1024
+	sizeGB := int((request.Value() + gib - 1) / gib)
+	if sizeGB < 1 {
+		sizeGB = 1
+	}
+	return sizeGB
+}
+
+// cachedVolume looks up a previously-created volume for this Pod's Volume
+// without creating anything, so a retried ensureVolumesForPod can reuse a
+// volume a prior, partially-failed CreatePod call already provisioned
+// instead of provisioning (and orphaning) a duplicate under the same name.
+func (p *ZunProvider) cachedVolume(pod *v1.Pod, volumeName string) (string, bool) {
+	p.volumeCacheMu.Lock()
+	defer p.volumeCacheMu.Unlock()
+	volumeID, ok := p.volumeCache[volumeCacheKey(pod, volumeName)]
+	return volumeID, ok
+}
+
+// rememberVolume records the volume backing a Pod's Volume so
+// cleanupVolumesForPod can find it again once the Pod object itself is
+// gone.
+func (p *ZunProvider) rememberVolume(pod *v1.Pod, volumeName, volumeID string) {
+	p.volumeCacheMu.Lock()
+	defer p.volumeCacheMu.Unlock()
+	p.volumeCache[volumeCacheKey(pod, volumeName)] = volumeID
+}
+
+// forgetVolume removes a volume ensureVolumesForPod rolled back from the
+// cache, without attempting to delete it again.
+func (p *ZunProvider) forgetVolume(pod *v1.Pod, volumeName string) {
+	p.volumeCacheMu.Lock()
+	defer p.volumeCacheMu.Unlock()
+	delete(p.volumeCache, volumeCacheKey(pod, volumeName))
+}
+
+// cleanupVolumesForPod drops from p.volumeCache every volume
+// ensureVolumesForPod recorded for this Pod's EmptyDir and
+// PersistentVolumeClaim volumes. PersistentVolumeClaim-backed volumes outlive the Pod by design
+// in Kubernetes, so only EmptyDir volumes are actually deleted here; PVC
+// volumes are simply dropped from the cache.
+func (p *ZunProvider) cleanupVolumesForPod(pod *v1.Pod) {
+	for _, vol := range pod.Spec.Volumes {
+		key := volumeCacheKey(pod, vol.Name)
+
+		p.volumeCacheMu.Lock()
+		volumeID, ok := p.volumeCache[key]
+		delete(p.volumeCache, key)
+		p.volumeCacheMu.Unlock()
+
+		if !ok || vol.EmptyDir == nil {
+			continue
+		}
+
+		if err := p.deleteVolume(volumeID); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// zunContainerReady reports a container's readiness. When a Healthcheck
+// was configured for it (see probeToHealthcheck), Zun's own health state
+// takes precedence over the "status==Running" shortcut, since a container
+// can be Running while its liveness/readiness probe is still failing.
+func zunContainerReady(cs *capsules.Container) bool {
+	if cs.Status != "Running" {
+		return false
+	}
+	if cs.Healthcheck == nil {
+		return true
+	}
+	return cs.Healthcheck.Status == "healthy" || cs.Healthcheck.Status == ""
+}
+
 func zunContainerStausToContainerStatus(cs *capsules.Container) v1.ContainerState {
 	// Zun already container start time but not add support at gophercloud
 	//startTime := metav1.NewTime(time.Time(cs.StartTime))
@@ -526,8 +1283,15 @@ func zunCapStatusToPodPhase(status string) v1.PodPhase {
 	return v1.PodUnknown
 }
 
-// Capacity returns a resource list containing the capacity limits set for ACI.
+// Capacity returns a resource list containing the capacity limits for this
+// node, resynced from Nova by p.nodeInfo. If that has never succeeded, it
+// falls back to the hard-coded defaults set in NewZunProvider (or the
+// config-supplied values) so the node still reports a usable Capacity.
 func (p *ZunProvider) Capacity() v1.ResourceList {
+	if capacity, ok := p.nodeInfo.getCapacity(); ok {
+		return capacity
+	}
+
 	return v1.ResourceList{
 		"cpu":    resource.MustParse(p.cpu),
 		"memory": resource.MustParse(p.memory),
@@ -0,0 +1,84 @@
+package openstack
+
+import (
+	"testing"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestGetProtocol(t *testing.T) {
+	cases := []struct {
+		name     string
+		protocol v1.Protocol
+		want     string
+	}{
+		{"tcp", v1.ProtocolTCP, "tcp"},
+		{"udp", v1.ProtocolUDP, "udp"},
+		{"sctp", v1.ProtocolSCTP, "sctp"},
+		{"empty defaults to tcp", v1.Protocol(""), "tcp"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := getProtocol(c.protocol); got != c.want {
+				t.Errorf("getProtocol(%q) = %q, want %q", c.protocol, got, c.want)
+			}
+		})
+	}
+}
+
+func TestTailOption(t *testing.T) {
+	cases := []struct {
+		name string
+		tail int
+		want string
+	}{
+		{"positive count", 50, "50"},
+		{"zero means all", 0, "all"},
+		{"negative means all", -1, "all"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := tailOption(c.tail); got != c.want {
+				t.Errorf("tailOption(%d) = %q, want %q", c.tail, got, c.want)
+			}
+		})
+	}
+}
+
+func TestPodToServicePorts(t *testing.T) {
+	pod := &v1.Pod{
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{
+				{
+					Name: "web",
+					Ports: []v1.ContainerPort{
+						{ContainerPort: 8080, Protocol: v1.ProtocolTCP},
+						{ContainerPort: 53, Protocol: v1.ProtocolUDP},
+					},
+				},
+				{
+					Name:  "sidecar",
+					Ports: nil,
+				},
+			},
+		},
+	}
+
+	ports := podToServicePorts(pod)
+	if len(ports) != 2 {
+		t.Fatalf("podToServicePorts() returned %d ports, want 2", len(ports))
+	}
+
+	want := []v1.ServicePort{
+		{Name: "web-8080", Port: 8080, TargetPort: intstr.FromInt(8080), Protocol: v1.ProtocolTCP},
+		{Name: "web-53", Port: 53, TargetPort: intstr.FromInt(53), Protocol: v1.ProtocolUDP},
+	}
+	for i, w := range want {
+		if ports[i] != w {
+			t.Errorf("podToServicePorts()[%d] = %+v, want %+v", i, ports[i], w)
+		}
+	}
+}